@@ -14,6 +14,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
 	"github.com/VictoriaMetrics/metricsql"
 	"gopkg.in/yaml.v2"
 )
@@ -21,6 +22,19 @@ import (
 // Global contains setting that can apply to the entire config file
 type Global struct {
 	Tenant string `yaml:"tenant"`
+	// Datasource, if set, overrides the instance-wide datasource URL and
+	// auth mode for every group that doesn't set its own.
+	Datasource *DatasourceConfig `yaml:"datasource,omitempty"`
+}
+
+// DatasourceConfig overrides the datasource URL and/or auth mode used to
+// evaluate a Group's rules, instead of the instance-wide default passed on
+// the command line.
+type DatasourceConfig struct {
+	URL string `yaml:"url,omitempty"`
+	// Auth must be a value, not a pointer: yaml.v2 only allows ,inline on a
+	// struct or map field, and rejects an inlined pointer at unmarshal time.
+	Auth promauth.HTTPClientConfig `yaml:",inline"`
 }
 
 // Group contains list of Rules grouped into
@@ -32,6 +46,9 @@ type Group struct {
 	Rules       []Rule        `yaml:"rules"`
 	Concurrency int           `yaml:"concurrency"`
 	Tenant      string        `yaml:"tenant"`
+	// Datasource overrides the instance-wide datasource URL and auth mode
+	// for this group only.
+	Datasource *DatasourceConfig `yaml:"datasource,omitempty"`
 	// Checksum stores the hash of yaml definition for this group.
 	// May be used to detect any changes like rules re-ordering etc.
 	Checksum string
@@ -56,17 +73,23 @@ func (g *Group) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
-// Validate check for internal Group or Rule configuration errors
+// Validate check for internal Group or Rule configuration errors. Unlike a
+// fail-fast check, it collects every problem it finds - across all rules -
+// into a single returned error, so operators can fix everything in one pass
+// instead of fixing and re-running repeatedly.
 func (g *Group) Validate(validateAnnotations, validateExpressions bool) error {
+	var errs multiError
+	ctx := fmt.Sprintf("group %q (file %q)", g.Name, g.File)
+
 	if g.Name == "" {
-		return fmt.Errorf("group name must be set")
+		errs.add(fmt.Errorf("%s: group name must be set", ctx))
 	}
 	if len(g.Rules) == 0 {
-		return fmt.Errorf("group %q can't contain no rules", g.Name)
+		errs.add(fmt.Errorf("%s: can't contain no rules", ctx))
 	}
 	// validate tenancy setting
 	if _, err := auth.NewToken(g.Tenant); err != nil {
-		return err
+		errs.add(fmt.Errorf("%s: %w", ctx, err))
 	}
 
 	uniqueRules := map[uint64]struct{}{}
@@ -76,39 +99,46 @@ func (g *Group) Validate(validateAnnotations, validateExpressions bool) error {
 			ruleName = r.Alert
 		}
 		if _, ok := uniqueRules[r.ID]; ok {
-			return fmt.Errorf("rule %q duplicate", ruleName)
+			errs.add(fmt.Errorf("%s: rule %q duplicate", ctx, ruleName))
+			continue
 		}
 		uniqueRules[r.ID] = struct{}{}
 		if err := r.Validate(); err != nil {
-			return fmt.Errorf("invalid rule %q.%q: %w", g.Name, ruleName, err)
+			errs.add(fmt.Errorf("%s: invalid rule %q: %w", ctx, ruleName, err))
 		}
 		if validateExpressions {
 			if _, err := metricsql.Parse(r.Expr); err != nil {
-				return fmt.Errorf("invalid expression for rule %q.%q: %w", g.Name, ruleName, err)
+				errs.add(fmt.Errorf("%s: invalid expression for rule %q: %w", ctx, ruleName, err))
 			}
 		}
 		if validateAnnotations {
 			if err := notifier.ValidateTemplates(r.Annotations); err != nil {
-				return fmt.Errorf("invalid annotations for rule %q.%q: %w", g.Name, ruleName, err)
+				errs.add(fmt.Errorf("%s: invalid annotations for rule %q: %w", ctx, ruleName, err))
 			}
 			if err := notifier.ValidateTemplates(r.Labels); err != nil {
-				return fmt.Errorf("invalid labels for rule %q.%q: %w", g.Name, ruleName, err)
+				errs.add(fmt.Errorf("%s: invalid labels for rule %q: %w", ctx, ruleName, err))
 			}
 		}
 	}
-	return checkOverflow(g.XXX, fmt.Sprintf("group %q", g.Name))
+	if err := checkOverflow(g.XXX, ctx); err != nil {
+		errs.add(err)
+	}
+	return errs.asError()
 }
 
 // Rule describes entity that represent either
 // recording rule or alerting rule.
 type Rule struct {
-	ID          uint64
-	Record      string            `yaml:"record,omitempty"`
-	Alert       string            `yaml:"alert,omitempty"`
-	Expr        string            `yaml:"expr"`
-	For         time.Duration     `yaml:"for,omitempty"`
-	Labels      map[string]string `yaml:"labels,omitempty"`
-	Annotations map[string]string `yaml:"annotations,omitempty"`
+	ID     uint64
+	Record string        `yaml:"record,omitempty"`
+	Alert  string        `yaml:"alert,omitempty"`
+	Expr   string        `yaml:"expr"`
+	For    time.Duration `yaml:"for,omitempty"`
+	// KeepFiringFor keeps an alert firing for this long after its expr
+	// stops matching, to smooth over brief gaps in the matched series.
+	KeepFiringFor time.Duration     `yaml:"keep_firing_for,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+	Annotations   map[string]string `yaml:"annotations,omitempty"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline"`
@@ -164,8 +194,9 @@ func (r *Rule) Validate() error {
 	return checkOverflow(r.XXX, "rule")
 }
 
-// Parse parses rule configs from given file patterns
-func Parse(pathPatterns []string, validateAnnotations, validateExpressions bool) ([]Group, error) {
+// resolveFiles expands pathPatterns into the concrete list of files they
+// currently match on disk.
+func resolveFiles(pathPatterns []string) ([]string, error) {
 	var fp []string
 	for _, pattern := range pathPatterns {
 		matches, err := filepath.Glob(pattern)
@@ -174,25 +205,43 @@ func Parse(pathPatterns []string, validateAnnotations, validateExpressions bool)
 		}
 		fp = append(fp, matches...)
 	}
+	return fp, nil
+}
+
+// Parse parses rule configs from given file patterns. It accumulates every
+// parse and validation error found across all files and groups, rather than
+// stopping at the first one, and returns them as a single error.
+func Parse(pathPatterns []string, validateAnnotations, validateExpressions bool) ([]Group, error) {
+	fp, err := resolveFiles(pathPatterns)
+	if err != nil {
+		return nil, err
+	}
 	var groups []Group
+	var errs multiError
 	for _, file := range fp {
 		uniqueGroups := map[string]struct{}{}
 		gr, err := parseFile(file)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse file %q: %w", file, err)
+			errs.add(fmt.Errorf("failed to parse file %q: %w", file, err))
+			continue
 		}
 		for _, g := range gr {
+			g.File = file
 			if err := g.Validate(validateAnnotations, validateExpressions); err != nil {
-				return nil, fmt.Errorf("invalid group %q in file %q: %w", g.Name, file, err)
+				errs.add(fmt.Errorf("invalid group %q in file %q: %w", g.Name, file, err))
+				continue
 			}
 			if _, ok := uniqueGroups[g.Name]; ok {
-				return nil, fmt.Errorf("group name %q duplicate in file %q", g.Name, file)
+				errs.add(fmt.Errorf("group name %q duplicate in file %q", g.Name, file))
+				continue
 			}
 			uniqueGroups[g.Name] = struct{}{}
-			g.File = file
 			groups = append(groups, g)
 		}
 	}
+	if err := errs.asError(); err != nil {
+		return nil, err
+	}
 	if len(groups) < 1 {
 		logger.Warnf("no groups found in %s", strings.Join(pathPatterns, ";"))
 	}
@@ -205,6 +254,9 @@ func parseFile(path string) ([]Group, error) {
 		return nil, fmt.Errorf("error reading alert rule file: %w", err)
 	}
 	data = envtemplate.Replace(data)
+	if looksLikePrometheusRules(path, data) {
+		return NewPrometheusImporter().Import(path, data)
+	}
 	g := struct {
 		Global *Global `yaml:"global"`
 		Groups []Group `yaml:"groups"`
@@ -227,9 +279,12 @@ func applyGlobal(groups []Group, global *Global) []Group {
 		return groups
 	}
 
-	for _, g := range groups {
-		if g.Tenant == "" {
-			g.Tenant = global.Tenant
+	for i := range groups {
+		if groups[i].Tenant == "" {
+			groups[i].Tenant = global.Tenant
+		}
+		if groups[i].Datasource == nil {
+			groups[i].Datasource = global.Datasource
 		}
 	}
 
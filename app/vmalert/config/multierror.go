@@ -0,0 +1,44 @@
+package config
+
+import "strings"
+
+// multiError accumulates multiple independent errors - e.g. one per invalid
+// rule or group - so that Parse and Validate can report every problem found
+// in a single pass instead of failing at the first one.
+type multiError []error
+
+// add appends err to me, if non-nil.
+func (me *multiError) add(err error) {
+	if err != nil {
+		*me = append(*me, err)
+	}
+}
+
+// asError returns me as an error, or nil if it is empty.
+func (me multiError) asError() error {
+	if len(me) == 0 {
+		return nil
+	}
+	return me
+}
+
+// Error implements the error interface, joining every collected error onto
+// its own line.
+func (me multiError) Error() string {
+	parts := make([]string, len(me))
+	for i, err := range me {
+		parts[i] = err.Error()
+	}
+	return strings.Join(parts, "\n")
+}
+
+// DryRun runs full validation for the rule files matched by pathPatterns
+// without starting vmalert, returning the aggregated validation report as
+// err. It is the library entry point a `-dryRun` CLI flag would call, to let
+// CI pipelines lint rule files without standing up a full vmalert instance;
+// no such flag is wired up yet, so callers must invoke DryRun directly until
+// one exists.
+func DryRun(pathPatterns []string, validateAnnotations, validateExpressions bool) error {
+	_, err := Parse(pathPatterns, validateAnnotations, validateExpressions)
+	return err
+}
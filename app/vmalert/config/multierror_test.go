@@ -0,0 +1,34 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMultiErrorEmpty(t *testing.T) {
+	var me multiError
+	me.add(nil)
+	if err := me.asError(); err != nil {
+		t.Fatalf("expected nil error for empty multiError, got %v", err)
+	}
+}
+
+func TestMultiErrorAccumulates(t *testing.T) {
+	var me multiError
+	me.add(errors.New("first"))
+	me.add(nil)
+	me.add(errors.New("second"))
+
+	err := me.asError()
+	if err == nil {
+		t.Fatal("expected non-nil error")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "first") || !strings.Contains(msg, "second") {
+		t.Fatalf("expected error message to contain both errors, got %q", msg)
+	}
+	if len(me) != 2 {
+		t.Fatalf("expected nil error to be skipped, got %d errors", len(me))
+	}
+}
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"crypto/md5"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// prometheusRuleMarker, when found as the leading line of a rule file,
+// marks it as native Prometheus rule YAML rather than this project's own
+// format.
+const prometheusRuleMarker = "# prometheus-rules"
+
+// prometheusRuleExt is an alternative to prometheusRuleMarker: any file
+// using it is treated as native Prometheus rule YAML regardless of content.
+const prometheusRuleExt = ".prom-rules.yml"
+
+// looksLikePrometheusRules reports whether file's extension or leading
+// marker line indicates native Prometheus rule YAML.
+func looksLikePrometheusRules(file string, data []byte) bool {
+	if strings.HasSuffix(file, prometheusRuleExt) {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimSpace(string(data)), prometheusRuleMarker)
+}
+
+// promRuleFile mirrors the top-level structure of a native Prometheus rule file.
+type promRuleFile struct {
+	Groups []promGroup `yaml:"groups"`
+}
+
+type promGroup struct {
+	Name     string        `yaml:"name"`
+	Interval time.Duration `yaml:"interval,omitempty"`
+	Rules    []promRule    `yaml:"rules"`
+}
+
+type promRule struct {
+	Record        string            `yaml:"record,omitempty"`
+	Alert         string            `yaml:"alert,omitempty"`
+	Expr          string            `yaml:"expr"`
+	For           time.Duration     `yaml:"for,omitempty"`
+	KeepFiringFor time.Duration     `yaml:"keep_firing_for,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+	Annotations   map[string]string `yaml:"annotations,omitempty"`
+}
+
+func (pr promRule) name() string {
+	if pr.Record != "" {
+		return pr.Record
+	}
+	return pr.Alert
+}
+
+// PrometheusImporter reads native Prometheus alerting/recording rule files
+// and translates them into this project's []Group structure, so existing
+// Prometheus rule libraries can be migrated without hand-editing every file.
+type PrometheusImporter struct {
+	// TranslateExpressions rewrites known PromQL constructs that differ in
+	// MetricsQL. Defaults to true via NewPrometheusImporter.
+	TranslateExpressions bool
+}
+
+// NewPrometheusImporter returns a PrometheusImporter with expression
+// translation enabled.
+func NewPrometheusImporter() *PrometheusImporter {
+	return &PrometheusImporter{TranslateExpressions: true}
+}
+
+// Import parses data as native Prometheus rule YAML and translates it into
+// this project's []Group structure. file tags the resulting groups' File
+// field, matching how parseFile tags groups parsed from this project's own
+// format, and names the file in error and warning messages.
+func (pi *PrometheusImporter) Import(file string, data []byte) ([]Group, error) {
+	var pf promRuleFile
+	if err := yaml.Unmarshal(data, &pf); err != nil {
+		return nil, fmt.Errorf("error parsing prometheus rule file %q: %w", file, err)
+	}
+	groups := make([]Group, 0, len(pf.Groups))
+	for _, pg := range pf.Groups {
+		g := Group{
+			File:     file,
+			Name:     pg.Name,
+			Interval: pg.Interval,
+		}
+		for _, pr := range pg.Rules {
+			r := Rule{
+				Record:        pr.Record,
+				Alert:         pr.Alert,
+				Expr:          pr.Expr,
+				For:           pr.For,
+				KeepFiringFor: pr.KeepFiringFor,
+				Labels:        pr.Labels,
+				Annotations:   pr.Annotations,
+			}
+			if pi.TranslateExpressions {
+				expr, err := Translate(r.Expr)
+				if err != nil {
+					logger.Warnf("prometheus import: file %q, group %q, rule %q: %s", file, pg.Name, pr.name(), err)
+				}
+				r.Expr = expr
+			}
+			r.ID = HashRule(r)
+			g.Rules = append(g.Rules, r)
+		}
+		b, err := yaml.Marshal(g)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal imported group %q for checksum: %w", g.Name, err)
+		}
+		h := md5.New()
+		h.Write(b)
+		g.Checksum = fmt.Sprintf("%x", h.Sum(nil))
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+// unsupportedPromQLConstructs lists PromQL functions with no MetricsQL
+// equivalent. Expressions using them are imported unchanged and flagged for
+// manual review.
+var unsupportedPromQLConstructs = []string{
+	// MetricsQL doesn't implement holt_winters - it was dropped as
+	// unreliable in practice. See the MetricsQL docs for alternatives.
+	"holt_winters(",
+}
+
+// knownTranslations maps a PromQL construct to its MetricsQL equivalent, for
+// cases where the same computation is spelled differently. It is currently
+// empty: populating it requires verifying each rewrite against the actual
+// MetricsQL semantics, which hasn't been done yet, so Translate is
+// detect-and-warn only for now rather than a general rewrite engine. Extend
+// it once real-world rule migrations have verified divergences to add.
+var knownTranslations = map[string]string{}
+
+// Translate rewrites expr's known PromQL-specific constructs into their
+// MetricsQL equivalents via knownTranslations, which is currently empty, so
+// in practice Translate only detects constructs with no MetricsQL
+// equivalent at all (unsupportedPromQLConstructs) and returns expr
+// unchanged along with a warning describing what it could not map, so the
+// caller can flag it for manual review instead of silently shipping a
+// broken expression.
+func Translate(expr string) (string, error) {
+	out := expr
+	for from, to := range knownTranslations {
+		out = strings.ReplaceAll(out, from, to)
+	}
+	for _, construct := range unsupportedPromQLConstructs {
+		if strings.Contains(out, construct) {
+			return out, fmt.Errorf("expression %q uses %q, which has no MetricsQL equivalent; imported unchanged and needs manual review", expr, construct)
+		}
+	}
+	return out, nil
+}
+
+// ConvertFile reads a native Prometheus rule file and returns it translated
+// into this project's YAML format. It is the library entry point a
+// `vmalert convert` subcommand would call; no such subcommand is wired up
+// yet, so callers must invoke ConvertFile directly until one exists.
+func ConvertFile(path string, data []byte) ([]byte, error) {
+	groups, err := NewPrometheusImporter().Import(path, data)
+	if err != nil {
+		return nil, err
+	}
+	out := struct {
+		Groups []Group `yaml:"groups"`
+	}{Groups: groups}
+	return yaml.Marshal(out)
+}
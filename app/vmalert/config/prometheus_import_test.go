@@ -0,0 +1,64 @@
+package config
+
+import "testing"
+
+func TestLooksLikePrometheusRules(t *testing.T) {
+	if !looksLikePrometheusRules("rules.prom-rules.yml", []byte("groups: []")) {
+		t.Error("expected file with prometheus rule extension to be detected")
+	}
+	if !looksLikePrometheusRules("rules.yml", []byte("# prometheus-rules\ngroups: []")) {
+		t.Error("expected file with leading marker to be detected")
+	}
+	if looksLikePrometheusRules("rules.yml", []byte("groups: []")) {
+		t.Error("did not expect a plain rule file to be detected as prometheus rules")
+	}
+}
+
+func TestTranslateUnsupportedConstruct(t *testing.T) {
+	expr := "holt_winters(foo[5m], 0.5, 0.5)"
+	out, err := Translate(expr)
+	if err == nil {
+		t.Fatal("expected an error for an unsupported construct")
+	}
+	if out != expr {
+		t.Errorf("expected unsupported expression to be returned unchanged, got %q", out)
+	}
+}
+
+func TestTranslateSupportedConstruct(t *testing.T) {
+	out, err := Translate("rate(foo[5m])")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if out != "rate(foo[5m])" {
+		t.Errorf("expected expression without known divergences to be unchanged, got %q", out)
+	}
+}
+
+func TestImportSetsChecksum(t *testing.T) {
+	data := []byte(`
+groups:
+  - name: g1
+    rules:
+      - record: foo
+        expr: rate(bar[5m])
+`)
+	groups, err := NewPrometheusImporter().Import("rules.prom-rules.yml", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(groups))
+	}
+	if groups[0].Checksum == "" {
+		t.Error("expected Import to set a non-empty Checksum")
+	}
+
+	groupsAgain, err := NewPrometheusImporter().Import("rules.prom-rules.yml", data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if groupsAgain[0].Checksum != groups[0].Checksum {
+		t.Error("expected Checksum to be stable for identical input")
+	}
+}
@@ -0,0 +1,268 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	fsnotify "gopkg.in/fsnotify.v1"
+)
+
+var (
+	configReloadTotal      = metrics.NewCounter(`vmalert_config_last_reload_total`)
+	configReloadErrors     = metrics.NewCounter(`vmalert_config_last_reload_errors_total`)
+	configReloadSuccessful = metrics.NewCounter(`vmalert_config_last_reload_successful`)
+)
+
+// GroupDiff describes how a single Group changed between two successive
+// Parse results.
+type GroupDiff struct {
+	// Group is the new version of the group.
+	Group Group
+
+	AddedRules   []Rule
+	RemovedRules []Rule
+	ChangedRules []Rule
+}
+
+// ConfigDiff describes the difference between two successive Parse results,
+// so callers can restart only the groups that actually changed instead of
+// the whole manager.
+type ConfigDiff struct {
+	AddedGroups   []Group
+	RemovedGroups []Group
+	ChangedGroups []GroupDiff
+}
+
+func (d ConfigDiff) isEmpty() bool {
+	return len(d.AddedGroups) == 0 && len(d.RemovedGroups) == 0 && len(d.ChangedGroups) == 0
+}
+
+// Watcher watches the files matched by a set of pathPatterns for changes,
+// via fsnotify and SIGHUP, and emits a ConfigDiff every time a re-parse
+// succeeds and differs from the previously loaded groups. A failed re-parse
+// retains the previous good config and only surfaces the error via logs and
+// the vmalert_config_last_reload_errors_total and
+// vmalert_config_last_reload_successful metrics, matching how
+// Prometheus handles reload failures.
+type Watcher struct {
+	pathPatterns        []string
+	validateAnnotations bool
+	validateExpressions bool
+
+	mu     sync.Mutex
+	groups []Group
+
+	fw     *fsnotify.Watcher
+	sigCh  chan os.Signal
+	diffCh chan ConfigDiff
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewWatcher creates a Watcher, performing an initial Parse of pathPatterns,
+// and starts watching the resolved files for changes.
+func NewWatcher(pathPatterns []string, validateAnnotations, validateExpressions bool) (*Watcher, error) {
+	groups, err := Parse(pathPatterns, validateAnnotations, validateExpressions)
+	if err != nil {
+		return nil, err
+	}
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create fsnotify watcher: %w", err)
+	}
+	w := &Watcher{
+		pathPatterns:        pathPatterns,
+		validateAnnotations: validateAnnotations,
+		validateExpressions: validateExpressions,
+		groups:              groups,
+		fw:                  fw,
+		sigCh:               make(chan os.Signal, 1),
+		diffCh:              make(chan ConfigDiff),
+		stopCh:              make(chan struct{}),
+	}
+	if err := w.watchFiles(); err != nil {
+		_ = fw.Close()
+		return nil, err
+	}
+	signal.Notify(w.sigCh, syscall.SIGHUP)
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+// Groups returns the most recently successfully parsed groups.
+func (w *Watcher) Groups() []Group {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.groups
+}
+
+// C returns the channel on which ConfigDiffs are delivered. It is never
+// closed while the Watcher is running.
+func (w *Watcher) C() <-chan ConfigDiff {
+	return w.diffCh
+}
+
+// Close stops watching for changes and releases the underlying fsnotify
+// watcher and signal handler.
+func (w *Watcher) Close() {
+	close(w.stopCh)
+	signal.Stop(w.sigCh)
+	_ = w.fw.Close()
+	w.wg.Wait()
+}
+
+func (w *Watcher) run() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-w.sigCh:
+			logger.Infof("SIGHUP received, reloading rule configs")
+			w.reload()
+		case event, ok := <-w.fw.Events:
+			if !ok {
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) == 0 {
+				continue
+			}
+			w.reload()
+		case err, ok := <-w.fw.Errors:
+			if !ok {
+				return
+			}
+			logger.Errorf("config watcher: %s", err)
+		}
+	}
+}
+
+// reload re-parses pathPatterns and, on success, diffs the result against
+// the previously loaded groups and publishes any change on diffCh. On
+// failure the previous good config is retained.
+func (w *Watcher) reload() {
+	configReloadTotal.Inc()
+	groups, err := Parse(w.pathPatterns, w.validateAnnotations, w.validateExpressions)
+	if err != nil {
+		configReloadErrors.Inc()
+		configReloadSuccessful.Set(0)
+		logger.Errorf("config watcher: keeping previous config, reload failed: %s", err)
+		return
+	}
+	configReloadSuccessful.Set(1)
+
+	w.mu.Lock()
+	prev := w.groups
+	w.groups = groups
+	w.mu.Unlock()
+
+	if err := w.watchFiles(); err != nil {
+		logger.Errorf("config watcher: %s", err)
+	}
+
+	diff := diffGroups(prev, groups)
+	if diff.isEmpty() {
+		return
+	}
+	select {
+	case w.diffCh <- diff:
+	case <-w.stopCh:
+	}
+}
+
+// watchFiles adds every file currently matched by pathPatterns to the
+// fsnotify watcher. It is idempotent: re-adding an already-watched file is
+// a no-op.
+func (w *Watcher) watchFiles() error {
+	files, err := resolveFiles(w.pathPatterns)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := w.fw.Add(f); err != nil {
+			return fmt.Errorf("cannot watch file %q: %w", f, err)
+		}
+	}
+	return nil
+}
+
+// groupKey identifies a Group across reloads. Group names are only required
+// to be unique within a single file, so the file path is part of the key.
+func groupKey(g Group) string {
+	return g.File + "/" + g.Name
+}
+
+func diffGroups(prev, next []Group) ConfigDiff {
+	prevByKey := make(map[string]Group, len(prev))
+	for _, g := range prev {
+		prevByKey[groupKey(g)] = g
+	}
+	nextByKey := make(map[string]Group, len(next))
+	for _, g := range next {
+		nextByKey[groupKey(g)] = g
+	}
+
+	var diff ConfigDiff
+	for key, g := range nextByKey {
+		old, ok := prevByKey[key]
+		if !ok {
+			diff.AddedGroups = append(diff.AddedGroups, g)
+			continue
+		}
+		if old.Checksum == g.Checksum {
+			continue
+		}
+		diff.ChangedGroups = append(diff.ChangedGroups, diffRules(old, g))
+	}
+	for key, g := range prevByKey {
+		if _, ok := nextByKey[key]; !ok {
+			diff.RemovedGroups = append(diff.RemovedGroups, g)
+		}
+	}
+	return diff
+}
+
+// diffRules compares rules by their Name(), since Rule.ID is derived from a
+// rule's expression and labels and so changes whenever its content does.
+// Group.Validate only enforces uniqueness of Rule.ID, not of Name(), so two
+// rules may legitimately share a name within one group; rules sharing a name
+// are paired up in the order they appear, so a same-named rule that is
+// merely edited is reported as changed rather than as one add plus one
+// remove, while a genuine count change at that name is reported as such.
+func diffRules(old, next Group) GroupDiff {
+	oldByName := make(map[string][]Rule, len(old.Rules))
+	for _, r := range old.Rules {
+		oldByName[r.Name()] = append(oldByName[r.Name()], r)
+	}
+	newByName := make(map[string][]Rule, len(next.Rules))
+	for _, r := range next.Rules {
+		newByName[r.Name()] = append(newByName[r.Name()], r)
+	}
+
+	gd := GroupDiff{Group: next}
+	for name, rs := range newByName {
+		olds := oldByName[name]
+		for i, r := range rs {
+			if i >= len(olds) {
+				gd.AddedRules = append(gd.AddedRules, r)
+				continue
+			}
+			if olds[i].ID != r.ID {
+				gd.ChangedRules = append(gd.ChangedRules, r)
+			}
+		}
+	}
+	for name, olds := range oldByName {
+		rs := newByName[name]
+		for i := len(rs); i < len(olds); i++ {
+			gd.RemovedRules = append(gd.RemovedRules, olds[i])
+		}
+	}
+	return gd
+}
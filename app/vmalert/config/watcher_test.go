@@ -0,0 +1,117 @@
+package config
+
+import "testing"
+
+func TestDiffGroupsAddedRemoved(t *testing.T) {
+	prev := []Group{
+		{File: "a.yml", Name: "g1", Checksum: "c1"},
+	}
+	next := []Group{
+		{File: "a.yml", Name: "g2", Checksum: "c2"},
+	}
+
+	diff := diffGroups(prev, next)
+	if len(diff.AddedGroups) != 1 || diff.AddedGroups[0].Name != "g2" {
+		t.Fatalf("expected g2 to be added, got %+v", diff.AddedGroups)
+	}
+	if len(diff.RemovedGroups) != 1 || diff.RemovedGroups[0].Name != "g1" {
+		t.Fatalf("expected g1 to be removed, got %+v", diff.RemovedGroups)
+	}
+	if len(diff.ChangedGroups) != 0 {
+		t.Fatalf("expected no changed groups, got %+v", diff.ChangedGroups)
+	}
+}
+
+func TestDiffGroupsUnchanged(t *testing.T) {
+	g := Group{File: "a.yml", Name: "g1", Checksum: "c1"}
+	diff := diffGroups([]Group{g}, []Group{g})
+	if !diff.isEmpty() {
+		t.Fatalf("expected empty diff for identical checksums, got %+v", diff)
+	}
+}
+
+func TestDiffGroupsChangedChecksumTriggersRuleDiff(t *testing.T) {
+	prev := []Group{{
+		File:     "a.yml",
+		Name:     "g1",
+		Checksum: "c1",
+		Rules: []Rule{
+			{Record: "keep", ID: 1},
+			{Record: "removed", ID: 2},
+		},
+	}}
+	next := []Group{{
+		File:     "a.yml",
+		Name:     "g1",
+		Checksum: "c2",
+		Rules: []Rule{
+			{Record: "keep", ID: 1},
+			{Record: "added", ID: 3},
+		},
+	}}
+
+	diff := diffGroups(prev, next)
+	if len(diff.ChangedGroups) != 1 {
+		t.Fatalf("expected 1 changed group, got %d", len(diff.ChangedGroups))
+	}
+	gd := diff.ChangedGroups[0]
+	if len(gd.AddedRules) != 1 || gd.AddedRules[0].Record != "added" {
+		t.Fatalf("expected 'added' rule to be added, got %+v", gd.AddedRules)
+	}
+	if len(gd.RemovedRules) != 1 || gd.RemovedRules[0].Record != "removed" {
+		t.Fatalf("expected 'removed' rule to be removed, got %+v", gd.RemovedRules)
+	}
+	if len(gd.ChangedRules) != 0 {
+		t.Fatalf("expected no changed rules, got %+v", gd.ChangedRules)
+	}
+}
+
+func TestDiffRulesDetectsChangedID(t *testing.T) {
+	old := Group{Rules: []Rule{{Record: "r", ID: 1}}}
+	next := Group{Rules: []Rule{{Record: "r", ID: 2}}}
+
+	gd := diffRules(old, next)
+	if len(gd.ChangedRules) != 1 || gd.ChangedRules[0].ID != 2 {
+		t.Fatalf("expected rule 'r' to be reported as changed, got %+v", gd.ChangedRules)
+	}
+	if len(gd.AddedRules) != 0 || len(gd.RemovedRules) != 0 {
+		t.Fatalf("expected no added/removed rules, got %+v / %+v", gd.AddedRules, gd.RemovedRules)
+	}
+}
+
+func TestDiffRulesHandlesDuplicateNames(t *testing.T) {
+	// Group.Validate only enforces uniqueness of Rule.ID, not Name(), so two
+	// alerting rules may legitimately share an alert name.
+	old := Group{Rules: []Rule{
+		{Alert: "Dup", ID: 1},
+		{Alert: "Dup", ID: 2},
+	}}
+	next := Group{Rules: []Rule{
+		{Alert: "Dup", ID: 1},
+		{Alert: "Dup", ID: 3},
+	}}
+
+	gd := diffRules(old, next)
+	if len(gd.ChangedRules) != 1 || gd.ChangedRules[0].ID != 3 {
+		t.Fatalf("expected the second 'Dup' rule to be reported as changed, got %+v", gd.ChangedRules)
+	}
+	if len(gd.AddedRules) != 0 || len(gd.RemovedRules) != 0 {
+		t.Fatalf("expected no added/removed rules for a same-count name change, got %+v / %+v", gd.AddedRules, gd.RemovedRules)
+	}
+}
+
+func TestDiffRulesHandlesDuplicateNameCountIncrease(t *testing.T) {
+	old := Group{Rules: []Rule{{Alert: "Dup", ID: 1}}}
+	next := Group{Rules: []Rule{
+		{Alert: "Dup", ID: 1},
+		{Alert: "Dup", ID: 2},
+	}}
+
+	gd := diffRules(old, next)
+	if len(gd.AddedRules) != 1 || gd.AddedRules[0].ID != 2 {
+		t.Fatalf("expected the extra 'Dup' rule to be reported as added, got %+v", gd.AddedRules)
+	}
+	if len(gd.ChangedRules) != 0 || len(gd.RemovedRules) != 0 {
+		t.Fatalf("expected no changed/removed rules, got %+v / %+v", gd.ChangedRules, gd.RemovedRules)
+	}
+}
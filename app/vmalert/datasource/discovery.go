@@ -0,0 +1,295 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"gopkg.in/yaml.v2"
+)
+
+// DiscoveryConfig configures dynamic resolution of a pool of backend URLs
+// for VMStorage, as an alternative to a single hardcoded baseURL. Exactly
+// one of Consul or File must be set.
+type DiscoveryConfig struct {
+	// Consul resolves backend URLs from a Consul service catalog.
+	Consul *ConsulSDConfig `yaml:"consul_sd_config,omitempty"`
+	// File resolves backend URLs from Prometheus file_sd-style target files.
+	File *FileSDConfig `yaml:"file_sd_config,omitempty"`
+}
+
+// ConsulSDConfig discovers backend URLs by watching the health of a named
+// service in a Consul catalog via long-polling blocking queries.
+type ConsulSDConfig struct {
+	// Server is the `host:port` address of the Consul HTTP API.
+	Server string `yaml:"server"`
+	// Service is the name of the service to watch.
+	Service string `yaml:"service"`
+	// Datacenter restricts the query to a single datacenter. Optional.
+	Datacenter string `yaml:"datacenter,omitempty"`
+	// Tag restricts the query to instances carrying the given tag. Optional.
+	Tag string `yaml:"tag,omitempty"`
+	// Token is the Consul ACL token to send with every request. Optional.
+	Token string `yaml:"token,omitempty"`
+	// Scheme is prepended to discovered addresses. Defaults to "http".
+	Scheme string `yaml:"scheme,omitempty"`
+}
+
+// FileSDConfig discovers backend URLs from Prometheus file_sd-style target
+// files and reloads them whenever the underlying files change on disk.
+type FileSDConfig struct {
+	// Files is a list of glob patterns pointing to target files in YAML or JSON format.
+	Files []string `yaml:"files"`
+	// Scheme is prepended to discovered targets, which file_sd only ever
+	// provides as a bare `host:port`. Defaults to "http".
+	Scheme string `yaml:"scheme,omitempty"`
+}
+
+// fileSDTargetGroup mirrors the Prometheus file_sd target group format.
+type fileSDTargetGroup struct {
+	Targets []string          `yaml:"targets" json:"targets"`
+	Labels  map[string]string `yaml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+// fileSDCheckInterval is how often file_sd target files are re-read for changes.
+const fileSDCheckInterval = 30 * time.Second
+
+// consulWatchTimeout is the `wait` duration passed to Consul blocking queries.
+const consulWatchTimeout = "5m"
+
+// discoverer resolves a set of backend URLs and pushes the current set to ch
+// every time it changes, until ctx is canceled.
+type discoverer interface {
+	run(ctx context.Context, c *http.Client, ch chan<- []string)
+}
+
+// newDiscoverer returns the discoverer configured by cfg.
+func newDiscoverer(cfg *DiscoveryConfig) (discoverer, error) {
+	switch {
+	case cfg.Consul != nil && cfg.File != nil:
+		return nil, fmt.Errorf("discovery config must set only one of consul_sd_config or file_sd_config")
+	case cfg.Consul != nil:
+		return &consulDiscoverer{cfg: cfg.Consul}, nil
+	case cfg.File != nil:
+		return &fileDiscoverer{cfg: cfg.File}, nil
+	default:
+		return nil, fmt.Errorf("discovery config must set either consul_sd_config or file_sd_config")
+	}
+}
+
+type consulDiscoverer struct {
+	cfg *ConsulSDConfig
+}
+
+type consulHealthEntry struct {
+	Service struct {
+		Address string `json:"Address"`
+		Port    int    `json:"Port"`
+	} `json:"Service"`
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+}
+
+// consulBackoff is how long run waits before retrying after a poll error or
+// an unusable X-Consul-Index, so a misbehaving Consul endpoint is retried at
+// a fixed rate instead of busy-looping it with non-blocking queries.
+const consulBackoff = 5 * time.Second
+
+// run long-polls Consul for changes to the health of cfg.Service, pushing the
+// resolved address list to ch after every observed change.
+func (cd *consulDiscoverer) run(ctx context.Context, c *http.Client, ch chan<- []string) {
+	scheme := cd.cfg.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	var index uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		addrs, newIndex, err := cd.poll(ctx, c, index)
+		if err != nil {
+			logger.Errorf("consul_sd: error polling service %q: %s", cd.cfg.Service, err)
+			if !sleepOrDone(ctx, consulBackoff) {
+				return
+			}
+			continue
+		}
+		if newIndex == 0 {
+			// Consul didn't return a usable X-Consul-Index (missing or not a
+			// valid integer, e.g. stripped by a proxy). Without it we can't
+			// safely issue a blocking query, so back off instead of hammering
+			// Consul with non-blocking polls.
+			logger.Errorf("consul_sd: service %q: response had no usable X-Consul-Index, backing off", cd.cfg.Service)
+			if !sleepOrDone(ctx, consulBackoff) {
+				return
+			}
+			continue
+		}
+		if newIndex < index {
+			// Consul documents that the index can go backwards, e.g. after a
+			// Raft snapshot restore. Resetting to 0 forces the next query to
+			// be non-blocking and re-synchronizes from scratch.
+			logger.Warnf("consul_sd: service %q: index went backwards (%d -> %d), resyncing", cd.cfg.Service, index, newIndex)
+			index = 0
+			continue
+		}
+		if newIndex == index {
+			continue
+		}
+		index = newIndex
+		urls := make([]string, len(addrs))
+		for i, a := range addrs {
+			urls[i] = scheme + "://" + a
+		}
+		select {
+		case ch <- urls:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sleepOrDone waits for d, returning false immediately if ctx is canceled
+// first.
+func sleepOrDone(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// poll issues a single Consul health query, blocking server-side for up to
+// consulWatchTimeout if index is positive. index must be 0 for the first,
+// non-blocking query.
+func (cd *consulDiscoverer) poll(ctx context.Context, c *http.Client, index uint64) ([]string, uint64, error) {
+	q := url.Values{}
+	q.Set("passing", "true")
+	q.Set("wait", consulWatchTimeout)
+	if index > 0 {
+		q.Set("index", strconv.FormatUint(index, 10))
+	}
+	if cd.cfg.Datacenter != "" {
+		q.Set("dc", cd.cfg.Datacenter)
+	}
+	if cd.cfg.Tag != "" {
+		q.Set("tag", cd.cfg.Tag)
+	}
+	u := fmt.Sprintf("http://%s/v1/health/service/%s?%s", cd.cfg.Server, cd.cfg.Service, q.Encode())
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if cd.cfg.Token != "" {
+		req.Header.Set("X-Consul-Token", cd.cfg.Token)
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error querying consul at %q: %w", cd.cfg.Server, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, 0, fmt.Errorf("unexpected response code %d from consul: %s", resp.StatusCode, body)
+	}
+	var entries []consulHealthEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("error parsing consul response: %w", err)
+	}
+	// A missing or malformed X-Consul-Index parses to 0, which run treats as
+	// "unusable" and backs off on, rather than busy-looping non-blocking
+	// queries against it.
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		addr := e.Service.Address
+		if addr == "" {
+			addr = e.Node.Address
+		}
+		addrs = append(addrs, fmt.Sprintf("%s:%d", addr, e.Service.Port))
+	}
+	return addrs, newIndex, nil
+}
+
+type fileDiscoverer struct {
+	cfg *FileSDConfig
+}
+
+// run re-reads cfg.Files every fileSDCheckInterval and pushes the resolved
+// target list to ch whenever the file contents change.
+func (fd *fileDiscoverer) run(ctx context.Context, c *http.Client, ch chan<- []string) {
+	var prevRaw string
+	for {
+		urls, raw, err := fd.resolve()
+		if err != nil {
+			logger.Errorf("file_sd: %s", err)
+		} else if raw != prevRaw {
+			prevRaw = raw
+			select {
+			case ch <- urls:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(fileSDCheckInterval):
+		}
+	}
+}
+
+// resolve reads and parses all files matched by cfg.Files and returns the
+// discovered target URLs along with the raw concatenated file contents so
+// callers can cheaply detect whether anything changed.
+func (fd *fileDiscoverer) resolve() ([]string, string, error) {
+	scheme := fd.cfg.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	var fp []string
+	for _, pattern := range fd.cfg.Files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading file_sd pattern %q: %w", pattern, err)
+		}
+		fp = append(fp, matches...)
+	}
+	var urls []string
+	var raw strings.Builder
+	for _, file := range fp {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, "", fmt.Errorf("error reading file_sd file %q: %w", file, err)
+		}
+		raw.Write(data)
+		var groups []fileSDTargetGroup
+		if strings.HasSuffix(file, ".json") {
+			err = json.Unmarshal(data, &groups)
+		} else {
+			err = yaml.Unmarshal(data, &groups)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("error parsing file_sd file %q: %w", file, err)
+		}
+		for _, g := range groups {
+			for _, t := range g.Targets {
+				urls = append(urls, scheme+"://"+t)
+			}
+		}
+	}
+	return urls, raw.String(), nil
+}
@@ -0,0 +1,128 @@
+package datasource
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFileSDFile(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write test file_sd file: %s", err)
+	}
+	return path
+}
+
+func TestFileDiscovererResolveDefaultScheme(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file_sd")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeFileSDFile(t, dir, "targets.yml", `
+- targets: ["host1:8428", "host2:8428"]
+`)
+
+	fd := &fileDiscoverer{cfg: &FileSDConfig{Files: []string{path}}}
+	urls, _, err := fd.resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := []string{"http://host1:8428", "http://host2:8428"}
+	if len(urls) != len(want) {
+		t.Fatalf("expected %d urls, got %d: %v", len(want), len(urls), urls)
+	}
+	for i, u := range urls {
+		if u != want[i] {
+			t.Errorf("url %d: got %q, want %q", i, u, want[i])
+		}
+	}
+}
+
+func TestFileDiscovererResolveCustomScheme(t *testing.T) {
+	dir, err := ioutil.TempDir("", "file_sd")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := writeFileSDFile(t, dir, "targets.yml", `
+- targets: ["host1:8428"]
+`)
+
+	fd := &fileDiscoverer{cfg: &FileSDConfig{Files: []string{path}, Scheme: "https"}}
+	urls, _, err := fd.resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(urls) != 1 || urls[0] != "https://host1:8428" {
+		t.Fatalf("expected [https://host1:8428], got %v", urls)
+	}
+}
+
+func consulServerAddr(srv *httptest.Server) string {
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func TestConsulPollReturnsParsedIndex(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Consul-Index", "42")
+		w.Write([]byte(`[{"Service":{"Address":"10.0.0.1","Port":8428},"Node":{"Address":""}}]`))
+	}))
+	defer srv.Close()
+
+	cd := &consulDiscoverer{cfg: &ConsulSDConfig{Server: consulServerAddr(srv), Service: "vmstorage"}}
+	addrs, index, err := cd.poll(context.Background(), srv.Client(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if index != 42 {
+		t.Errorf("expected index 42, got %d", index)
+	}
+	if len(addrs) != 1 || addrs[0] != "10.0.0.1:8428" {
+		t.Fatalf("expected [10.0.0.1:8428], got %v", addrs)
+	}
+}
+
+func TestConsulPollMissingIndexParsesToZero(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// deliberately omit X-Consul-Index, as a misbehaving proxy might
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	cd := &consulDiscoverer{cfg: &ConsulSDConfig{Server: consulServerAddr(srv), Service: "vmstorage"}}
+	_, index, err := cd.poll(context.Background(), srv.Client(), 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if index != 0 {
+		t.Errorf("expected a missing X-Consul-Index to parse to 0, got %d", index)
+	}
+}
+
+func TestConsulPollOmitsIndexParamWhenZero(t *testing.T) {
+	var gotQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Header().Set("X-Consul-Index", "1")
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	cd := &consulDiscoverer{cfg: &ConsulSDConfig{Server: consulServerAddr(srv), Service: "vmstorage"}}
+	if _, _, err := cd.poll(context.Background(), srv.Client(), 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if strings.Contains(gotQuery, "index=") {
+		t.Errorf("expected the first poll (index=0) to omit the index param, got query %q", gotQuery)
+	}
+}
@@ -0,0 +1,24 @@
+package datasource
+
+// Label represents a single label of a Metric.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single (timestamp, value) pair of a time series, as returned
+// by a range query.
+type Sample struct {
+	Timestamp int64
+	Value     float64
+}
+
+// Metric is the basic entity returned by a datasource query. For instant
+// queries, Timestamp/Value hold the single returned sample. For range
+// queries, Samples holds the full series and Timestamp/Value are left zero.
+type Metric struct {
+	Labels    []Label
+	Timestamp int64
+	Value     float64
+	Samples   []Sample
+}
@@ -3,15 +3,22 @@ package datasource
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/auth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 )
 
 type response struct {
@@ -48,12 +55,58 @@ func (r response) metrics() ([]Metric, error) {
 	return ms, nil
 }
 
+// failureThreshold is the number of consecutive failures after which a
+// target is considered unhealthy and is skipped until it succeeds again.
+const failureThreshold = 3
+
+// target is a single backend endpoint in VMStorage's pool, together with
+// its rolling health state.
+type target struct {
+	url string
+
+	mu      sync.Mutex
+	fails   int
+	healthy bool
+}
+
+func newTarget(url string) *target {
+	return &target{url: url, healthy: true}
+}
+
+func (t *target) isHealthy() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.healthy
+}
+
+func (t *target) markSuccess() {
+	t.mu.Lock()
+	t.healthy = true
+	t.fails = 0
+	t.mu.Unlock()
+}
+
+func (t *target) markFailure() {
+	t.mu.Lock()
+	t.fails++
+	if t.fails >= failureThreshold {
+		t.healthy = false
+	}
+	t.mu.Unlock()
+}
+
 // VMStorage represents vmstorage entity with ability to read and write metrics
 type VMStorage struct {
-	c                *http.Client
-	url              string
-	basicAuthUser    string
-	basicAuthPass    string
+	c *http.Client
+
+	targetsMu sync.RWMutex
+	targets   []*target
+	rrIdx     uint32
+
+	cancelDiscovery context.CancelFunc
+	rw              *remotewrite.Client
+
+	auth             *promauth.Config
 	lookBack         time.Duration
 	tenancy          bool
 	defaultAuthToken *auth.Token
@@ -61,33 +114,195 @@ type VMStorage struct {
 
 const queryPath = "/api/v1/query?query="
 
-// NewVMStorage is a constructor for VMStorage
-func NewVMStorage(baseURL, basicAuthUser, basicAuthPass string, tenancy bool, lookBack time.Duration, c *http.Client) (*VMStorage, error) {
-	storage := VMStorage{
-		c:             c,
-		url:           strings.TrimSuffix(baseURL, "/"),
-		basicAuthUser: basicAuthUser,
-		basicAuthPass: basicAuthPass,
-		lookBack:      lookBack,
+// NewVMStorage is a constructor for VMStorage. Either baseURL or discoveryCfg
+// (or both) must be set: baseURL configures a single static backend, while
+// discoveryCfg resolves and periodically refreshes a pool of backend URLs.
+// When both are set, baseURL is used as the initial target until discovery
+// produces its first result.
+//
+// Tenancy support requires baseURL to be set, since the default tenant token
+// is derived from it. Every target, baseURL and each discovered one alike, is
+// turned into its own tenant path template by formatTargetURL.
+//
+// remoteWriteCfg, if non-nil, configures Write to push recording rule
+// results to a remote-write destination; it is a no-op otherwise.
+//
+// authCfg configures how requests to every target are authenticated; see
+// promauth.HTTPClientConfig for the supported modes.
+func NewVMStorage(baseURL string, discoveryCfg *DiscoveryConfig, remoteWriteCfg *remotewrite.Config, authCfg *promauth.HTTPClientConfig, tenancy bool, lookBack time.Duration, c *http.Client) (*VMStorage, error) {
+	if baseURL == "" && discoveryCfg == nil {
+		return nil, fmt.Errorf("either baseURL or discovery config must be set")
+	}
+	authConf, err := promauth.NewConfig(authCfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth config: %w", err)
+	}
+	authConf.ApplyToClient(c)
+	storage := &VMStorage{
+		c:        c,
+		auth:     authConf,
+		lookBack: lookBack,
 	}
 	if tenancy {
-		token, formatter, err := auth.FindToken(storage.url)
+		if baseURL == "" {
+			return nil, fmt.Errorf("tenancy requires baseURL to be set")
+		}
+		token, _, err := auth.FindToken(strings.TrimSuffix(baseURL, "/"))
 		if err != nil {
 			return nil, fmt.Errorf("invalid url addr format: %q", err)
 		}
 		storage.tenancy = true
 		storage.defaultAuthToken = token
-		storage.url = formatter
 	}
-	return &storage, nil
+	if baseURL != "" {
+		u, err := storage.formatTargetURL(baseURL)
+		if err != nil {
+			return nil, err
+		}
+		storage.targets = []*target{newTarget(u)}
+	}
+	if discoveryCfg != nil {
+		d, err := newDiscoverer(discoveryCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid discovery config: %w", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		storage.cancelDiscovery = cancel
+		ch := make(chan []string)
+		go d.run(ctx, c, ch)
+		go storage.watchTargets(ctx, ch)
+	}
+	if remoteWriteCfg != nil {
+		rw, err := remotewrite.NewClient(*remoteWriteCfg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid remote-write config: %w", err)
+		}
+		storage.rw = rw
+	}
+	return storage, nil
+}
+
+// watchTargets applies every target list received on ch to the pool, until
+// ctx is canceled.
+func (s *VMStorage) watchTargets(ctx context.Context, ch <-chan []string) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case urls := <-ch:
+			s.applyTargets(urls)
+		}
+	}
+}
+
+// formatTargetURL trims a trailing slash from rawURL and, when tenancy is
+// enabled, turns it into the %s-templated form expected by queryTarget and
+// queryRangeTarget. It is used for both the initial baseURL target and every
+// target produced by discovery, so the tenant path formatter is applied
+// verbatim to every target in the pool, not just the first one.
+func (s *VMStorage) formatTargetURL(rawURL string) (string, error) {
+	u := strings.TrimSuffix(rawURL, "/")
+	if !s.tenancy {
+		return u, nil
+	}
+	_, formatter, err := auth.FindToken(u)
+	if err != nil {
+		return "", fmt.Errorf("invalid url addr format: %q", err)
+	}
+	return formatter, nil
+}
+
+func (s *VMStorage) applyTargets(urls []string) {
+	targets := make([]*target, 0, len(urls))
+	for _, u := range urls {
+		fu, err := s.formatTargetURL(u)
+		if err != nil {
+			logger.Warnf("datasource: skipping discovered target %q: %s", u, err)
+			continue
+		}
+		targets = append(targets, newTarget(fu))
+	}
+	s.targetsMu.Lock()
+	s.targets = targets
+	s.targetsMu.Unlock()
+}
+
+// Close stops the background discovery goroutine and remote-write client,
+// if configured.
+func (s *VMStorage) Close() {
+	if s.cancelDiscovery != nil {
+		s.cancelDiscovery()
+	}
+	if s.rw != nil {
+		_ = s.rw.Close()
+	}
+}
+
+// orderedTargets returns the current target pool starting at the next
+// round-robin position, with unhealthy targets moved to the end so they are
+// only tried once every healthy target has failed.
+func (s *VMStorage) orderedTargets() []*target {
+	s.targetsMu.RLock()
+	targets := s.targets
+	s.targetsMu.RUnlock()
+
+	n := len(targets)
+	if n == 0 {
+		return nil
+	}
+	start := int(atomic.AddUint32(&s.rrIdx, 1)) % n
+	ordered := make([]*target, 0, n)
+	var unhealthy []*target
+	for i := 0; i < n; i++ {
+		t := targets[(start+i)%n]
+		if t.isHealthy() {
+			ordered = append(ordered, t)
+		} else {
+			unhealthy = append(unhealthy, t)
+		}
+	}
+	return append(ordered, unhealthy...)
 }
 
+// badRequestError marks a response that a different target wouldn't fix -
+// e.g. a client error caused by a malformed query - so Query/QueryRange can
+// return it immediately instead of marking the target unhealthy and
+// sweeping across the rest of the pool.
+type badRequestError struct {
+	err error
+}
+
+func (e *badRequestError) Error() string { return e.err.Error() }
+func (e *badRequestError) Unwrap() error { return e.err }
+
 // Query reads metrics from datasource by given query
 func (s *VMStorage) Query(ctx context.Context, at *auth.Token, query string) ([]Metric, error) {
+	targets := s.orderedTargets()
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no healthy datasource targets available")
+	}
+	var lastErr error
+	for _, t := range targets {
+		ms, err := s.queryTarget(ctx, t, at, query)
+		if err == nil {
+			t.markSuccess()
+			return ms, nil
+		}
+		var bre *badRequestError
+		if errors.As(err, &bre) {
+			return nil, bre.err
+		}
+		t.markFailure()
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (s *VMStorage) queryTarget(ctx context.Context, t *target, at *auth.Token, query string) ([]Metric, error) {
 	const (
 		statusSuccess, statusError, rtVector = "success", "error", "vector"
 	)
-	q := s.url
+	q := t.url
 	if s.tenancy {
 		if at == nil {
 			at = s.defaultAuthToken
@@ -104,8 +319,8 @@ func (s *VMStorage) Query(ctx context.Context, at *auth.Token, query string) ([]
 		return nil, err
 	}
 	req.Header.Set("Content-Type", "application/json")
-	if s.basicAuthPass != "" {
-		req.SetBasicAuth(s.basicAuthUser, s.basicAuthPass)
+	if err := s.auth.SetHeaders(req); err != nil {
+		return nil, err
 	}
 	resp, err := s.c.Do(req.WithContext(ctx))
 	if err != nil {
@@ -114,7 +329,11 @@ func (s *VMStorage) Query(ctx context.Context, at *auth.Token, query string) ([]
 	defer func() { _ = resp.Body.Close() }()
 	if resp.StatusCode != http.StatusOK {
 		body, _ := ioutil.ReadAll(resp.Body)
-		return nil, fmt.Errorf("datasource returns unexpected response code %d for %s. Reponse body %s", resp.StatusCode, req.URL, body)
+		err := fmt.Errorf("datasource returns unexpected response code %d for %s. Reponse body %s", resp.StatusCode, req.URL, body)
+		if resp.StatusCode/100 == 4 {
+			return nil, &badRequestError{err: err}
+		}
+		return nil, err
 	}
 	r := &response{}
 	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
@@ -131,3 +350,141 @@ func (s *VMStorage) Query(ctx context.Context, at *auth.Token, query string) ([]
 	}
 	return r.metrics()
 }
+
+type rangeResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Labels map[string]string `json:"metric"`
+			Values [][2]interface{}  `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+}
+
+func (r rangeResponse) metrics() ([]Metric, error) {
+	var ms []Metric
+	for _, res := range r.Data.Result {
+		var m Metric
+		for k, v := range res.Labels {
+			m.Labels = append(m.Labels, Label{Name: k, Value: v})
+		}
+		for _, tv := range res.Values {
+			f, err := strconv.ParseFloat(tv[1].(string), 64)
+			if err != nil {
+				return nil, fmt.Errorf("metric %v, unable to parse float64 from %s: %w", res, tv[1], err)
+			}
+			m.Samples = append(m.Samples, Sample{Timestamp: int64(tv[0].(float64)), Value: f})
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
+const queryRangePath = "/api/v1/query_range?query="
+
+// QueryRange reads a range of samples for query between start and end,
+// spaced step apart, as produced by recording rules that need historical
+// data rather than a single instant evaluation.
+func (s *VMStorage) QueryRange(ctx context.Context, at *auth.Token, query string, start, end time.Time, step time.Duration) ([]Metric, error) {
+	targets := s.orderedTargets()
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no healthy datasource targets available")
+	}
+	var lastErr error
+	for _, t := range targets {
+		ms, err := s.queryRangeTarget(ctx, t, at, query, start, end, step)
+		if err == nil {
+			t.markSuccess()
+			return ms, nil
+		}
+		var bre *badRequestError
+		if errors.As(err, &bre) {
+			return nil, bre.err
+		}
+		t.markFailure()
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (s *VMStorage) queryRangeTarget(ctx context.Context, t *target, at *auth.Token, query string, start, end time.Time, step time.Duration) ([]Metric, error) {
+	const (
+		statusSuccess, statusError, rtMatrix = "success", "error", "matrix"
+	)
+	q := t.url
+	if s.tenancy {
+		if at == nil {
+			at = s.defaultAuthToken
+		}
+		q = fmt.Sprintf(q, at.String())
+	}
+	q = q + queryRangePath + url.QueryEscape(query)
+	q += fmt.Sprintf("&start=%d&end=%d&step=%ds", start.Unix(), end.Unix(), int64(step.Seconds()))
+	req, err := http.NewRequest("POST", q, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := s.auth.SetHeaders(req); err != nil {
+		return nil, err
+	}
+	resp, err := s.c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("error getting response from %s: %w", req.URL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		err := fmt.Errorf("datasource returns unexpected response code %d for %s. Reponse body %s", resp.StatusCode, req.URL, body)
+		if resp.StatusCode/100 == 4 {
+			return nil, &badRequestError{err: err}
+		}
+		return nil, err
+	}
+	r := &rangeResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return nil, fmt.Errorf("error parsing metrics for %s: %w", req.URL, err)
+	}
+	if r.Status == statusError {
+		return nil, fmt.Errorf("response error, query: %s, errorType: %s, error: %s", req.URL, r.ErrorType, r.Error)
+	}
+	if r.Status != statusSuccess {
+		return nil, fmt.Errorf("unknown status: %s, Expected success or error ", r.Status)
+	}
+	if r.Data.ResultType != rtMatrix {
+		return nil, fmt.Errorf("unknown restul type:%s. Expected matrix", r.Data.ResultType)
+	}
+	return r.metrics()
+}
+
+// Write pushes recording rule results to the remote-write destination
+// configured via remoteWriteCfg in NewVMStorage. It is a no-op if none was
+// configured, so callers don't need to special-case an alerting-only setup.
+//
+// remote-write only ever targets a single cfg.URL, so tenancy here cannot
+// route series to a per-tenant endpoint the way Query/QueryRange do via the
+// tenant URL path; it only stamps the tenant onto each series as a label so a
+// downstream multitenant endpoint (or relabeling rule) can split the stream.
+func (s *VMStorage) Write(ctx context.Context, at *auth.Token, tss []prompbmarshal.TimeSeries) error {
+	if s.rw == nil {
+		return nil
+	}
+	if s.tenancy {
+		if at == nil {
+			at = s.defaultAuthToken
+		}
+		tagged := make([]prompbmarshal.TimeSeries, len(tss))
+		for i, ts := range tss {
+			labels := make([]prompbmarshal.Label, len(ts.Labels), len(ts.Labels)+1)
+			copy(labels, ts.Labels)
+			ts.Labels = append(labels, prompbmarshal.Label{Name: "vm_account_id", Value: at.String()})
+			tagged[i] = ts
+		}
+		tss = tagged
+	}
+	s.rw.Push(tss)
+	return nil
+}
@@ -0,0 +1,169 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+)
+
+func newTestStorage(t *testing.T, targets ...string) *VMStorage {
+	t.Helper()
+	authConf, err := promauth.NewConfig(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts := make([]*target, len(targets))
+	for i, u := range targets {
+		ts[i] = newTarget(u)
+	}
+	return &VMStorage{
+		c:       &http.Client{},
+		auth:    authConf,
+		targets: ts,
+	}
+}
+
+func TestOrderedTargetsRoundRobin(t *testing.T) {
+	s := &VMStorage{targets: []*target{
+		newTarget("a"),
+		newTarget("b"),
+		newTarget("c"),
+	}}
+
+	seen := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		ordered := s.orderedTargets()
+		if len(ordered) != 3 {
+			t.Fatalf("expected 3 targets, got %d", len(ordered))
+		}
+		seen[ordered[0].url]++
+	}
+	for _, u := range []string{"a", "b", "c"} {
+		if seen[u] != 2 {
+			t.Errorf("expected %q to be first exactly twice across 6 calls, got %d", u, seen[u])
+		}
+	}
+}
+
+func TestOrderedTargetsUnhealthyMovedToEnd(t *testing.T) {
+	healthy := newTarget("healthy")
+	unhealthy := newTarget("unhealthy")
+	for i := 0; i < failureThreshold; i++ {
+		unhealthy.markFailure()
+	}
+	if unhealthy.isHealthy() {
+		t.Fatal("expected target to be unhealthy after failureThreshold failures")
+	}
+
+	s := &VMStorage{targets: []*target{unhealthy, healthy}}
+	ordered := s.orderedTargets()
+	if ordered[len(ordered)-1] != unhealthy {
+		t.Fatalf("expected unhealthy target to be ordered last, got %+v", ordered)
+	}
+}
+
+func TestMarkSuccessRestoresHealth(t *testing.T) {
+	tg := newTarget("t")
+	for i := 0; i < failureThreshold; i++ {
+		tg.markFailure()
+	}
+	if tg.isHealthy() {
+		t.Fatal("expected target to be unhealthy")
+	}
+	tg.markSuccess()
+	if !tg.isHealthy() {
+		t.Fatal("expected markSuccess to restore health")
+	}
+}
+
+func TestQueryTarget4xxIsNotRetryable(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	s := newTestStorage(t, srv.URL)
+	_, err := s.queryTarget(context.Background(), s.targets[0], nil, "invalid(")
+	if err == nil {
+		t.Fatal("expected an error for a 400 response")
+	}
+	var bre *badRequestError
+	if !errors.As(err, &bre) {
+		t.Errorf("expected a 4xx response to be a *badRequestError, got %T: %s", err, err)
+	}
+}
+
+func TestQueryTarget5xxIsRetryable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	s := newTestStorage(t, srv.URL)
+	_, err := s.queryTarget(context.Background(), s.targets[0], nil, "up")
+	if err == nil {
+		t.Fatal("expected an error for a 500 response")
+	}
+	var bre *badRequestError
+	if errors.As(err, &bre) {
+		t.Error("did not expect a 5xx response to be a *badRequestError")
+	}
+}
+
+func TestQueryFailsOverFromUnhealthyTarget(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	}))
+	defer good.Close()
+
+	s := newTestStorage(t, "http://127.0.0.1:0", good.URL)
+	s.targets[0].healthy = false
+	ms, err := s.Query(context.Background(), nil, "up")
+	if err != nil {
+		t.Fatalf("expected failover to the healthy target to succeed, got %s", err)
+	}
+	if len(ms) != 0 {
+		t.Errorf("expected an empty result, got %v", ms)
+	}
+}
+
+func TestQueryReturns4xxImmediatelyWithoutFailover(t *testing.T) {
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	s := newTestStorage(t, srv.URL, srv.URL)
+	_, err := s.Query(context.Background(), nil, "invalid(")
+	if err == nil {
+		t.Fatal("expected an error for a 400 response")
+	}
+	if hits != 1 {
+		t.Errorf("expected a 4xx response to short-circuit without trying other targets, got %d requests", hits)
+	}
+	for _, tg := range s.targets {
+		if !tg.isHealthy() {
+			t.Errorf("expected target %q to remain healthy after a 4xx response, it was marked unhealthy", tg.url)
+		}
+	}
+}
+
+func TestApplyTargetsTrimsTrailingSlash(t *testing.T) {
+	s := &VMStorage{}
+	s.applyTargets([]string{"http://host1:8480/"})
+
+	if len(s.targets) != 1 {
+		t.Fatalf("expected 1 target, got %d", len(s.targets))
+	}
+	if got, want := s.targets[0].url, "http://host1:8480"; got != want {
+		t.Errorf("expected trailing slash to be trimmed, got %q want %q", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+)
+
+// Alert is the minimal representation of a firing or resolved alert pushed
+// to an Alertmanager-compatible receiver.
+type Alert struct {
+	Labels       map[string]string
+	Annotations  map[string]string
+	StartsAt     time.Time
+	EndsAt       time.Time
+	GeneratorURL string
+}
+
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+const alertsPath = "/api/v2/alerts"
+
+// Alertmanager pushes alerts to a single Alertmanager-compatible HTTP
+// target, authenticating every request the same way datasource.VMStorage
+// does - via the shared promauth config surface - so alertmanager targets
+// support basic auth, bearer tokens, mutual TLS and OAuth2 client
+// credentials just like the datasource does.
+type Alertmanager struct {
+	addr string
+	c    *http.Client
+	auth *promauth.Config
+}
+
+// NewAlertmanager is a constructor for Alertmanager.
+func NewAlertmanager(addr string, authCfg *promauth.HTTPClientConfig, c *http.Client) (*Alertmanager, error) {
+	auth, err := promauth.NewConfig(authCfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth config: %w", err)
+	}
+	auth.ApplyToClient(c)
+	return &Alertmanager{
+		addr: strings.TrimSuffix(addr, "/"),
+		c:    c,
+		auth: auth,
+	}, nil
+}
+
+// Send pushes alerts to the Alertmanager v2 API.
+func (am *Alertmanager) Send(ctx context.Context, alerts []Alert) error {
+	payload := make([]alertmanagerAlert, len(alerts))
+	for i, a := range alerts {
+		aa := alertmanagerAlert{
+			Labels:       a.Labels,
+			Annotations:  a.Annotations,
+			GeneratorURL: a.GeneratorURL,
+		}
+		if !a.StartsAt.IsZero() {
+			aa.StartsAt = a.StartsAt.Format(time.RFC3339Nano)
+		}
+		if !a.EndsAt.IsZero() {
+			aa.EndsAt = a.EndsAt.Format(time.RFC3339Nano)
+		}
+		payload[i] = aa
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error marshaling alerts: %w", err)
+	}
+	req, err := http.NewRequest("POST", am.addr+alertsPath, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := am.auth.SetHeaders(req); err != nil {
+		return err
+	}
+	resp, err := am.c.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("error sending alerts to %q: %w", am.addr, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected response code %d from alertmanager %q: %s", resp.StatusCode, am.addr, body)
+	}
+	return nil
+}
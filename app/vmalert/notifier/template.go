@@ -0,0 +1,17 @@
+package notifier
+
+import (
+	"fmt"
+	"text/template"
+)
+
+// ValidateTemplates checks that every value in m parses as a valid Go
+// template, as used for rule labels and annotations.
+func ValidateTemplates(m map[string]string) error {
+	for k, v := range m {
+		if _, err := template.New(k).Parse(v); err != nil {
+			return fmt.Errorf("error parsing template %q: %w", k, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+// Package remotewrite pushes recording rule results to a remote-write
+// endpoint using the Prometheus remote-write protobuf+snappy wire format.
+package remotewrite
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/golang/snappy"
+)
+
+// defaultFlushInterval is how often pending series are batched and sent
+// when MaxBatchSize isn't reached first.
+const defaultFlushInterval = 5 * time.Second
+
+// defaultMaxBatchSize is the default number of time series buffered before
+// a batch is flushed early, regardless of FlushInterval.
+const defaultMaxBatchSize = 1000
+
+// maxSendRetries bounds the number of immediate send attempts, the first one
+// included, for a single batch before it is handed off to the on-disk queue.
+const maxSendRetries = 3
+
+// Config configures a Client.
+type Config struct {
+	// URL is the remote-write endpoint time series are pushed to.
+	URL string
+	// FlushInterval is the maximum time pending series sit in memory before
+	// being sent. Defaults to defaultFlushInterval.
+	FlushInterval time.Duration
+	// MaxBatchSize is the number of time series that triggers an early
+	// flush. Defaults to defaultMaxBatchSize.
+	MaxBatchSize int
+	// QueueDir, if set, persists batches that failed to send to disk so
+	// they survive a restart and are retried on the next run.
+	QueueDir string
+	// Client is the http.Client used to send requests. Defaults to a
+	// client with a 30s timeout.
+	Client *http.Client
+}
+
+// Client batches time series and pushes them to a remote-write endpoint,
+// retrying failed sends and spilling undeliverable batches to an on-disk
+// queue for durability across restarts.
+type Client struct {
+	cfg Config
+
+	mu      sync.Mutex
+	pending []prompbmarshal.TimeSeries
+
+	queue *diskQueue
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewClient creates a Client from cfg and starts its background flush loop.
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("remote-write URL must be set")
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	if cfg.MaxBatchSize <= 0 {
+		cfg.MaxBatchSize = defaultMaxBatchSize
+	}
+	q, err := newDiskQueue(cfg.QueueDir)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		cfg:    cfg,
+		queue:  q,
+		stopCh: make(chan struct{}),
+	}
+	c.wg.Add(1)
+	go c.run()
+	return c, nil
+}
+
+// Push enqueues tss to be sent on the next flush.
+func (c *Client) Push(tss []prompbmarshal.TimeSeries) {
+	c.mu.Lock()
+	c.pending = append(c.pending, tss...)
+	full := len(c.pending) >= c.cfg.MaxBatchSize
+	c.mu.Unlock()
+	if full {
+		c.flush()
+	}
+}
+
+// Close flushes any pending data and stops the background sender.
+func (c *Client) Close() error {
+	close(c.stopCh)
+	c.wg.Wait()
+	return nil
+}
+
+func (c *Client) run() {
+	defer c.wg.Done()
+	t := time.NewTicker(c.cfg.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.stopCh:
+			c.flush()
+			return
+		case <-t.C:
+			c.flush()
+			c.drainQueue()
+		}
+	}
+}
+
+func (c *Client) flush() {
+	c.mu.Lock()
+	tss := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+	if len(tss) == 0 {
+		return
+	}
+	data, err := marshalWriteRequest(tss)
+	if err != nil {
+		logger.Errorf("remotewrite: cannot marshal batch of %d series: %s", len(tss), err)
+		return
+	}
+	if err := c.send(data); err != nil {
+		logger.Errorf("remotewrite: %s; persisting batch to disk queue", err)
+		if qerr := c.queue.enqueue(data); qerr != nil {
+			logger.Errorf("remotewrite: failed to persist batch to disk queue: %s", qerr)
+		}
+	}
+}
+
+// drainQueue attempts to resend previously persisted batches in the order
+// they were written, stopping at the first failure to preserve ordering.
+func (c *Client) drainQueue() {
+	names, err := c.queue.list()
+	if err != nil {
+		logger.Errorf("remotewrite: cannot list disk queue: %s", err)
+		return
+	}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			logger.Errorf("remotewrite: cannot read queued batch %q: %s", name, err)
+			continue
+		}
+		if err := c.send(data); err != nil {
+			return
+		}
+		if err := c.queue.remove(name); err != nil {
+			logger.Errorf("remotewrite: cannot remove queued batch %q: %s", name, err)
+		}
+	}
+}
+
+// send delivers an already-marshaled, snappy-encoded WriteRequest payload,
+// retrying on 5xx responses and connection errors.
+func (c *Client) send(data []byte) error {
+	var lastErr error
+	for attempt := 0; attempt < maxSendRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		req, err := http.NewRequest("POST", c.cfg.URL, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+		resp, err := c.cfg.Client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("error sending batch to %q: %w", c.cfg.URL, err)
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		lastErr = fmt.Errorf("unexpected response code %d from %q: %s", resp.StatusCode, c.cfg.URL, body)
+		if resp.StatusCode/100 != 5 {
+			// non-5xx errors won't be fixed by retrying the same payload
+			return lastErr
+		}
+	}
+	return lastErr
+}
+
+func marshalWriteRequest(tss []prompbmarshal.TimeSeries) ([]byte, error) {
+	wr := prompbmarshal.WriteRequest{Timeseries: tss}
+	data, err := wr.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal WriteRequest: %w", err)
+	}
+	return snappy.Encode(nil, data), nil
+}
+
+// diskQueue persists marshaled batches as individual files in a directory,
+// providing durability for data that couldn't be sent immediately. A nil
+// *diskQueue is valid and a no-op, matching an unconfigured QueueDir.
+type diskQueue struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func newDiskQueue(dir string) (*diskQueue, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("cannot create remote-write queue dir %q: %w", dir, err)
+	}
+	return &diskQueue{dir: dir}, nil
+}
+
+func (q *diskQueue) enqueue(data []byte) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	name := filepath.Join(q.dir, fmt.Sprintf("%d.wr", time.Now().UnixNano()))
+	return ioutil.WriteFile(name, data, 0640)
+}
+
+func (q *diskQueue) list() ([]string, error) {
+	if q == nil {
+		return nil, nil
+	}
+	entries, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, filepath.Join(q.dir, e.Name()))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (q *diskQueue) remove(name string) error {
+	return os.Remove(name)
+}
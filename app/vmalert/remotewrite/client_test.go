@@ -0,0 +1,95 @@
+package remotewrite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskQueueNilIsNoOp(t *testing.T) {
+	var q *diskQueue
+	if err := q.enqueue([]byte("data")); err != nil {
+		t.Fatalf("expected nil diskQueue enqueue to be a no-op, got %s", err)
+	}
+	names, err := q.list()
+	if err != nil {
+		t.Fatalf("expected nil diskQueue list to be a no-op, got %s", err)
+	}
+	if names != nil {
+		t.Fatalf("expected nil diskQueue list to return nil, got %v", names)
+	}
+}
+
+func TestDiskQueueEnqueueListRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remotewrite_queue")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	q, err := newDiskQueue(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := q.enqueue([]byte("batch-1")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := q.enqueue([]byte("batch-2")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	names, err := q.list()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("expected 2 queued batches, got %d", len(names))
+	}
+
+	data, err := ioutil.ReadFile(names[0])
+	if err != nil {
+		t.Fatalf("unexpected error reading queued batch: %s", err)
+	}
+	if string(data) != "batch-1" {
+		t.Errorf("expected oldest batch to be listed first, got %q", data)
+	}
+
+	if err := q.remove(names[0]); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	names, err = q.list()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(names) != 1 {
+		t.Fatalf("expected 1 queued batch after removal, got %d", len(names))
+	}
+}
+
+func TestNewDiskQueueEmptyDirIsNoOp(t *testing.T) {
+	q, err := newDiskQueue("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if q != nil {
+		t.Fatalf("expected nil *diskQueue for empty dir, got %+v", q)
+	}
+}
+
+func TestNewDiskQueueCreatesDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remotewrite_queue_create")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	nested := filepath.Join(dir, "nested", "queue")
+	if _, err := newDiskQueue(nested); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(nested); err != nil {
+		t.Fatalf("expected newDiskQueue to create %q: %s", nested, err)
+	}
+}
@@ -0,0 +1,188 @@
+// Package promauth provides shared HTTP authentication config for
+// components that talk to Prometheus-compatible endpoints - datasource
+// queries and Alertmanager notifications alike - so every caller supports
+// the same set of auth modes.
+package promauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// BasicAuthConfig holds HTTP basic auth credentials.
+type BasicAuthConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// TLSConfig holds settings for authenticating via mutual TLS and/or
+// verifying the server's certificate against a custom CA.
+type TLSConfig struct {
+	// CertFile and KeyFile, if set, are presented to the server as a client
+	// certificate.
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// CAFile, if set, overrides the system root CA pool used to verify the
+	// server's certificate.
+	CAFile string `yaml:"ca_file,omitempty"`
+	// ServerName, if set, overrides the hostname used for certificate
+	// verification.
+	ServerName string `yaml:"server_name,omitempty"`
+	// InsecureSkipVerify disables server certificate verification.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+}
+
+// OAuth2Config holds settings for the OAuth2 client-credentials flow.
+type OAuth2Config struct {
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	TokenURL     string   `yaml:"token_url"`
+	Scopes       []string `yaml:"scopes,omitempty"`
+}
+
+// HTTPClientConfig is the YAML-facing configuration of an auth mode for an
+// outgoing HTTP client. At most one of BasicAuth, BearerToken,
+// BearerTokenFile or OAuth2 may be set; TLSConfig may be combined with any
+// of them.
+type HTTPClientConfig struct {
+	BasicAuth *BasicAuthConfig `yaml:"basic_auth,omitempty"`
+	// BearerToken is sent verbatim as `Authorization: Bearer <token>`.
+	BearerToken string `yaml:"bearer_token,omitempty"`
+	// BearerTokenFile is re-read on every request, so the token can be
+	// rotated on disk without restarting the process.
+	BearerTokenFile string        `yaml:"bearer_token_file,omitempty"`
+	TLSConfig       *TLSConfig    `yaml:"tls_config,omitempty"`
+	OAuth2          *OAuth2Config `yaml:"oauth2,omitempty"`
+}
+
+// Config is the resolved form of an HTTPClientConfig, ready to be applied
+// to an *http.Client and to individual requests.
+type Config struct {
+	basicAuthUser string
+	basicAuthPass string
+
+	bearerToken     string
+	bearerTokenFile string
+
+	tlsConfig *tls.Config
+
+	oauth2 *oauth2TokenSource
+}
+
+// NewConfig validates cfg and builds a Config from it. A nil cfg is valid
+// and results in a Config that performs no authentication.
+func NewConfig(cfg *HTTPClientConfig) (*Config, error) {
+	c := &Config{}
+	if cfg == nil {
+		return c, nil
+	}
+	modes := 0
+	if cfg.BasicAuth != nil {
+		modes++
+	}
+	if cfg.BearerToken != "" {
+		modes++
+	}
+	if cfg.BearerTokenFile != "" {
+		modes++
+	}
+	if cfg.OAuth2 != nil {
+		modes++
+	}
+	if modes > 1 {
+		return nil, fmt.Errorf("only one of basic_auth, bearer_token, bearer_token_file or oauth2 may be set")
+	}
+	if cfg.BasicAuth != nil {
+		c.basicAuthUser = cfg.BasicAuth.Username
+		c.basicAuthPass = cfg.BasicAuth.Password
+	}
+	c.bearerToken = cfg.BearerToken
+	c.bearerTokenFile = cfg.BearerTokenFile
+	if cfg.OAuth2 != nil {
+		c.oauth2 = newOAuth2TokenSource(cfg.OAuth2)
+	}
+	if cfg.TLSConfig != nil {
+		tc, err := newTLSConfig(cfg.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		c.tlsConfig = tc
+	}
+	return c, nil
+}
+
+// ApplyToClient installs this Config's TLS settings onto hc's Transport. It
+// is a no-op if no TLS config was set.
+func (c *Config) ApplyToClient(hc *http.Client) {
+	if c.tlsConfig == nil {
+		return
+	}
+	var transport *http.Transport
+	if t, ok := hc.Transport.(*http.Transport); ok && t != nil {
+		transport = t.Clone()
+	} else {
+		transport = &http.Transport{}
+	}
+	transport.TLSClientConfig = c.tlsConfig
+	hc.Transport = transport
+}
+
+// SetHeaders sets the Authorization header implied by the configured auth
+// mode on req. It is a no-op if no mode was configured.
+func (c *Config) SetHeaders(req *http.Request) error {
+	switch {
+	case c.basicAuthUser != "" || c.basicAuthPass != "":
+		req.SetBasicAuth(c.basicAuthUser, c.basicAuthPass)
+	case c.bearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	case c.bearerTokenFile != "":
+		token, err := ioutil.ReadFile(c.bearerTokenFile)
+		if err != nil {
+			return fmt.Errorf("cannot read bearer_token_file %q: %w", c.bearerTokenFile, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+trimTrailingNewline(token))
+	case c.oauth2 != nil:
+		token, err := c.oauth2.token()
+		if err != nil {
+			return fmt.Errorf("cannot obtain oauth2 token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+func trimTrailingNewline(b []byte) string {
+	for len(b) > 0 && (b[len(b)-1] == '\n' || b[len(b)-1] == '\r') {
+		b = b[:len(b)-1]
+	}
+	return string(b)
+}
+
+func newTLSConfig(cfg *TLSConfig) (*tls.Config, error) {
+	tc := &tls.Config{
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load TLS client cert/key from %q/%q: %w", cfg.CertFile, cfg.KeyFile, err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read ca_file %q: %w", cfg.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("cannot parse any certificates from ca_file %q", cfg.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	return tc, nil
+}
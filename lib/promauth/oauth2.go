@@ -0,0 +1,94 @@
+package promauth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTokenLifetime is used when a token endpoint doesn't return
+// expires_in.
+const defaultTokenLifetime = 5 * time.Minute
+
+// tokenExpiryMargin is subtracted from a token's reported lifetime so a
+// refresh happens slightly before the token actually expires.
+const tokenExpiryMargin = 10 * time.Second
+
+// oauth2TokenSource fetches and caches an access token via the OAuth2
+// client-credentials flow, refreshing it once it is close to expiry.
+type oauth2TokenSource struct {
+	cfg *OAuth2Config
+	c   *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+func newOAuth2TokenSource(cfg *OAuth2Config) *oauth2TokenSource {
+	return &oauth2TokenSource{
+		cfg: cfg,
+		c:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// token returns a cached, still-valid access token, fetching a new one if
+// necessary.
+func (ts *oauth2TokenSource) token() (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.accessToken != "" && time.Now().Before(ts.expiresAt) {
+		return ts.accessToken, nil
+	}
+	token, lifetime, err := ts.fetch()
+	if err != nil {
+		return "", err
+	}
+	ts.accessToken = token
+	ts.expiresAt = time.Now().Add(lifetime - tokenExpiryMargin)
+	return ts.accessToken, nil
+}
+
+func (ts *oauth2TokenSource) fetch() (string, time.Duration, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", ts.cfg.ClientID)
+	form.Set("client_secret", ts.cfg.ClientSecret)
+	if len(ts.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(ts.cfg.Scopes, " "))
+	}
+	req, err := http.NewRequest("POST", ts.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := ts.c.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("error requesting oauth2 token from %q: %w", ts.cfg.TokenURL, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", 0, fmt.Errorf("unexpected response code %d from oauth2 token endpoint %q: %s", resp.StatusCode, ts.cfg.TokenURL, body)
+	}
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", 0, fmt.Errorf("error parsing oauth2 token response from %q: %w", ts.cfg.TokenURL, err)
+	}
+	if tr.AccessToken == "" {
+		return "", 0, fmt.Errorf("oauth2 token endpoint %q returned an empty access_token", ts.cfg.TokenURL)
+	}
+	lifetime := defaultTokenLifetime
+	if tr.ExpiresIn > 0 {
+		lifetime = time.Duration(tr.ExpiresIn) * time.Second
+	}
+	return tr.AccessToken, lifetime, nil
+}
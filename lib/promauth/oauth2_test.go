@@ -0,0 +1,82 @@
+package promauth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOAuth2TokenSourceCachesToken(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `{"access_token":"tok-%d","expires_in":3600}`, requests)
+	}))
+	defer srv.Close()
+
+	ts := newOAuth2TokenSource(&OAuth2Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		TokenURL:     srv.URL,
+	})
+
+	tok1, err := ts.token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tok2, err := ts.token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if tok1 != tok2 {
+		t.Errorf("expected cached token to be reused, got %q then %q", tok1, tok2)
+	}
+	if requests != 1 {
+		t.Errorf("expected exactly 1 token request, got %d", requests)
+	}
+}
+
+func TestOAuth2TokenSourceRefetchesAfterExpiry(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// expires_in shorter than tokenExpiryMargin forces immediate re-fetch
+		// on the next call, without needing to sleep in the test.
+		fmt.Fprintf(w, `{"access_token":"tok-%d","expires_in":1}`, requests)
+	}))
+	defer srv.Close()
+
+	ts := newOAuth2TokenSource(&OAuth2Config{
+		ClientID:     "id",
+		ClientSecret: "secret",
+		TokenURL:     srv.URL,
+	})
+
+	tok1, err := ts.token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tok2, err := ts.token()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if tok1 == tok2 {
+		t.Errorf("expected an already-expired token to be refetched, got %q both times", tok1)
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 token requests, got %d", requests)
+	}
+}
+
+func TestOAuth2TokenSourceEmptyAccessTokenErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token":"","expires_in":3600}`)
+	}))
+	defer srv.Close()
+
+	ts := newOAuth2TokenSource(&OAuth2Config{TokenURL: srv.URL})
+	if _, err := ts.token(); err == nil {
+		t.Fatal("expected an error for an empty access_token response")
+	}
+}